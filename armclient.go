@@ -19,12 +19,15 @@ import (
 )
 
 const (
-	appVersion   = "0.2.3"
-	userAgentStr = "github.com/yangl900/armclient-go"
-	flagVerbose  = "verbose"
-	flagRaw      = "raw, r"
-	flagTenantID = "tenant, t"
-	flagHeader   = "header, H"
+	appVersion      = "0.2.3"
+	userAgentStr    = "github.com/yangl900/armclient-go"
+	flagVerbose     = "verbose"
+	flagRaw         = "raw, r"
+	flagTenantID    = "tenant, t"
+	flagHeader      = "header, H"
+	flagMetadataURL = "metadata-url"
+	flagARMEndpoint = "arm-endpoint"
+	flagAADEndpoint = "aad-endpoint"
 )
 
 func main() {
@@ -46,6 +49,16 @@ func main() {
 		return nil
 	}
 
+	app.Before = func(c *cli.Context) error {
+		if mode := c.GlobalString(strings.Split(flagAuthMode, ",")[0]); mode != "" {
+			os.Setenv(envAuthMode, mode)
+		}
+		if cloud := c.GlobalString(strings.Split(flagCloud, ",")[0]); cloud != "" {
+			os.Setenv(envCloud, cloud)
+		}
+		return nil
+	}
+
 	log.SetOutput(ioutil.Discard)
 
 	verboseFlag := cli.BoolFlag{
@@ -68,14 +81,61 @@ func main() {
 		Usage: "Specify the tenant Id.",
 	}
 
-	app.Flags = []cli.Flag{verboseFlag}
+	authModeFlag := cli.StringFlag{
+		Name:   flagAuthMode,
+		Usage:  "Authentication mode: cli (default), sp, msi or devicecode.",
+		EnvVar: envAuthMode,
+	}
+
+	cloudFlag := cli.StringFlag{
+		Name:   flagCloud,
+		Usage:  "Target cloud: AzurePublic (default), AzureUSGovernment, AzureChina, AzureGermany, or a registered custom cloud.",
+		EnvVar: envCloud,
+	}
+
+	waitFlag := cli.BoolFlag{
+		Name:  flagWait,
+		Usage: "Wait for long-running operations (Azure-AsyncOperation / Location) to reach a terminal state.",
+	}
+
+	waitTimeoutFlag := cli.DurationFlag{
+		Name:  flagWaitTimeout,
+		Usage: "Maximum time to wait for a long-running operation to complete.",
+		Value: defaultWaitTimeout,
+	}
+
+	pollIntervalFlag := cli.DurationFlag{
+		Name:  flagPollInterval,
+		Usage: "Polling interval used while waiting for a long-running operation, when Retry-After isn't set.",
+		Value: defaultPollInterval,
+	}
+
+	logFileFlag := cli.StringFlag{
+		Name:  flagLogFile,
+		Usage: "Append each request/response pair to the given file in HTTP Archive (HAR) format.",
+	}
+
+	logAuthFlag := cli.BoolFlag{
+		Name:  flagLogAuth,
+		Usage: "Include the Authorization header value in --log-file output instead of redacting it.",
+	}
+
+	dryRunFlag := cli.BoolFlag{
+		Name:  flagDryRun,
+		Usage: "Print the fully-formed request without sending it.",
+	}
+
+	app.Flags = []cli.Flag{verboseFlag, authModeFlag, cloudFlag, logFileFlag, logAuthFlag, dryRunFlag}
 
 	app.Commands = []cli.Command{
 		{
 			Name:   "get",
 			Action: doRequest,
 			Usage:  "Makes a GET request to ARM endpoint.",
-			Flags:  []cli.Flag{verboseFlag, headerFlag},
+			Flags: []cli.Flag{verboseFlag, headerFlag,
+				cli.BoolFlag{Name: flagAllPages, Usage: "Transparently follow nextLink until exhausted and merge the results into a single document."},
+				cli.IntFlag{Name: flagMaxPages, Usage: "Maximum number of pages to follow with --all-pages.", Value: defaultMaxPages},
+			},
 		},
 		{
 			Name:   "head",
@@ -87,25 +147,25 @@ func main() {
 			Name:   "put",
 			Action: doRequest,
 			Usage:  "Makes a PUT request to ARM endpoint.",
-			Flags:  []cli.Flag{verboseFlag, headerFlag},
+			Flags:  []cli.Flag{verboseFlag, headerFlag, waitFlag, waitTimeoutFlag, pollIntervalFlag},
 		},
 		{
 			Name:   "patch",
 			Action: doRequest,
 			Usage:  "Makes a PATCH request to ARM endpoint.",
-			Flags:  []cli.Flag{verboseFlag, headerFlag},
+			Flags:  []cli.Flag{verboseFlag, headerFlag, waitFlag, waitTimeoutFlag, pollIntervalFlag},
 		},
 		{
 			Name:   "delete",
 			Action: doRequest,
 			Usage:  "Makes a DELETE request to ARM endpoint.",
-			Flags:  []cli.Flag{verboseFlag, headerFlag},
+			Flags:  []cli.Flag{verboseFlag, headerFlag, waitFlag, waitTimeoutFlag, pollIntervalFlag},
 		},
 		{
 			Name:   "post",
 			Action: doRequest,
 			Usage:  "Makes a POST request to ARM endpoint.",
-			Flags:  []cli.Flag{verboseFlag, headerFlag},
+			Flags:  []cli.Flag{verboseFlag, headerFlag, waitFlag, waitTimeoutFlag, pollIntervalFlag},
 		},
 		{
 			Name:   "token",
@@ -133,6 +193,48 @@ func main() {
 					Action: printTenants,
 					Usage:  "Shows all tenants.",
 				},
+				{
+					Name:   "discover",
+					Action: discoverTenant,
+					Usage:  "Discovers the tenant Id owning a subscription, via the unauthenticated 401 WWW-Authenticate probe.",
+				},
+			},
+		},
+		{
+			Name:   "cloud",
+			Action: printCloud,
+			Usage:  "Manage Azure clouds (public, sovereign or custom). Set / show active cloud.",
+			Subcommands: []cli.Command{
+				{
+					Name:   "set",
+					Action: setActiveCloud,
+					Usage:  "Sets the active cloud.",
+				},
+				{
+					Name:   "show",
+					Action: printCloud,
+					Usage:  "Shows the active cloud's endpoints.",
+				},
+				{
+					Name:   "register",
+					Action: registerCloud,
+					Usage:  "Registers a custom cloud (e.g. Azure Stack), either from explicit endpoints or a metadata URL.",
+					Flags: []cli.Flag{
+						cli.StringFlag{Name: flagMetadataURL, Usage: "ARM metadata endpoint to auto-populate endpoints from, e.g. https://management.local.azurestack.external"},
+						cli.StringFlag{Name: flagARMEndpoint, Usage: "Resource Manager endpoint, e.g. https://management.local.azurestack.external"},
+						cli.StringFlag{Name: flagAADEndpoint, Usage: "Active Directory authority endpoint, e.g. https://login.microsoftonline.com"},
+					},
+				},
+			},
+		},
+		{
+			Name:      "batch",
+			Action:    runBatch,
+			Usage:     "Executes multiple ARM requests described in a JSON or YAML file.",
+			ArgsUsage: "<path to batch file>",
+			Flags: []cli.Flag{
+				cli.IntFlag{Name: flagParallel, Usage: "Maximum number of requests to run concurrently (ignored with --server-side).", Value: 1},
+				cli.BoolFlag{Name: flagServerSide, Usage: "Submit the batch as a single request to ARM's native POST /batch endpoint instead of issuing requests individually."},
 			},
 		},
 	}
@@ -211,21 +313,84 @@ func doRequest(c *cli.Context) error {
 		}
 	}
 
+	if c.GlobalBool(flagDryRun) {
+		printDryRun(req, []byte(reqBody), c.GlobalBool(flagLogAuth))
+		return nil
+	}
+
 	start := time.Now()
 	response, err := client.Do(req)
 	if err != nil {
 		return errors.New("Request failed: " + err.Error())
 	}
 
-	defer response.Body.Close()
-	buf, err := ioutil.ReadAll(response.Body)
+	if response.StatusCode == http.StatusUnauthorized {
+		retried, retriedToken, retryErr := retryWithDiscoveredTenant(client, req, []byte(reqBody), response)
+		if retryErr != nil {
+			return retryErr
+		}
+		if retried != nil {
+			response = retried
+			token = retriedToken
+		}
+	}
 
-	if err != nil {
-		return errors.New("Request failed: " + err.Error())
+	// loggedRequest is the request that actually produced the response above: after a 401
+	// tenant-discovery retry that's the retried request (req itself still carries the stale,
+	// failed Authorization header). Captured before --wait below reassigns response to the final
+	// poll's response, whose .Request is the internal status-check GET, not this write request.
+	loggedRequest := req
+	if response.Request != nil {
+		loggedRequest = response.Request
+	}
+
+	var buf []byte
+
+	if c.Bool(strings.Split(flagWait, ",")[0]) {
+		initiatingResponse := response
+		waited, waitedBody, waitErr := waitForOperation(client, token, response,
+			c.Duration(flagWaitTimeout), c.Duration(flagPollInterval), c.GlobalBool(flagVerbose) || c.Bool(flagVerbose))
+		if waited != initiatingResponse {
+			// waitForOperation polled and returned a different response (or none, on error); the
+			// initiating response's body was never consumed and must be closed explicitly here,
+			// since the defer below now closes whatever response ends up in scope.
+			initiatingResponse.Body.Close()
+		}
+		if waited != nil {
+			response = waited
+		}
+		defer response.Body.Close()
+		if waitErr != nil {
+			return cli.NewExitError(waitErr.Error(), 1)
+		}
+		buf = waitedBody
+	} else {
+		defer response.Body.Close()
+	}
+
+	if buf == nil {
+		buf, err = ioutil.ReadAll(response.Body)
+		if err != nil {
+			return errors.New("Request failed: " + err.Error())
+		}
+	}
+
+	if logFile := c.GlobalString(flagLogFile); logFile != "" {
+		if err := appendHARLogEntry(logFile, loggedRequest, []byte(reqBody), response, buf, start, time.Now().Sub(start), c.GlobalBool(flagLogAuth)); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write HAR log: %v\n", err)
+		}
 	}
 
 	if c.GlobalBool(flagVerbose) || c.Bool(flagVerbose) {
-		fmt.Println(responseDetail(response, time.Now().Sub(start), headerNames))
+		fmt.Println(responseDetail(loggedRequest, response, time.Now().Sub(start), headerNames))
+	}
+
+	verbose := c.GlobalBool(flagVerbose) || c.Bool(flagVerbose)
+	if c.Command.Name == "get" && c.Bool(strings.Split(flagAllPages, ",")[0]) {
+		buf, err = followAllPages(client, loggedRequest.Header, buf, c.Int(flagMaxPages), verbose)
+		if err != nil {
+			return fmt.Errorf("Failed to follow pages: %v", err)
+		}
 	}
 
 	fmt.Println(prettyJSON(buf))
@@ -0,0 +1,422 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	envAuthMode        = "ARMCLIENT_AUTH_MODE"
+	flagAuthMode       = "auth-mode"
+	authModeCLI        = "cli"
+	authModeSP         = "sp"
+	authModeMSI        = "msi"
+	authModeDeviceCode = "devicecode"
+	imdsTokenEndpoint  = "http://169.254.169.254/metadata/identity/oauth2/token"
+)
+
+// TokenProvider acquires a bearer token for a given tenant, caching is handled by the caller.
+type TokenProvider interface {
+	AcquireToken(tenantID string) (token string, expiresOn time.Time, err error)
+}
+
+type cachedToken struct {
+	Token     string    `json:"token"`
+	ExpiresOn time.Time `json:"expiresOn"`
+}
+
+func currentAuthMode() string {
+	if mode := os.Getenv(envAuthMode); mode != "" {
+		return mode
+	}
+
+	return authModeCLI
+}
+
+func tokenProviderFor(mode string) (TokenProvider, error) {
+	switch mode {
+	case authModeCLI, "":
+		return cliTokenProvider{}, nil
+	case authModeSP:
+		return servicePrincipalTokenProvider{}, nil
+	case authModeMSI:
+		return managedIdentityTokenProvider{}, nil
+	case authModeDeviceCode:
+		return deviceCodeTokenProvider{}, nil
+	default:
+		return nil, fmt.Errorf("Unknown auth mode: %s", mode)
+	}
+}
+
+func tokenCachePath(tenantID, mode string) (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	dir := filepath.Join(home, ".armclient", "tokens")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, fmt.Sprintf("%s_%s_%s.json", currentCloudName(), mode, tenantID)), nil
+}
+
+func readCachedToken(tenantID, mode string) (cachedToken, bool) {
+	path, err := tokenCachePath(tenantID, mode)
+	if err != nil {
+		return cachedToken{}, false
+	}
+
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return cachedToken{}, false
+	}
+
+	var ct cachedToken
+	if err := json.Unmarshal(buf, &ct); err != nil {
+		return cachedToken{}, false
+	}
+
+	if time.Now().Add(2 * time.Minute).After(ct.ExpiresOn) {
+		return cachedToken{}, false
+	}
+
+	return ct, true
+}
+
+func writeCachedToken(tenantID, mode string, ct cachedToken) {
+	path, err := tokenCachePath(tenantID, mode)
+	if err != nil {
+		return
+	}
+
+	buf, err := json.Marshal(ct)
+	if err != nil {
+		return
+	}
+
+	ioutil.WriteFile(path, buf, 0600)
+}
+
+func acquireAuthToken(tenantID string) (string, error) {
+	mode := currentAuthMode()
+
+	if cached, ok := readCachedToken(tenantID, mode); ok {
+		return cached.Token, nil
+	}
+
+	provider, err := tokenProviderFor(mode)
+	if err != nil {
+		return "", err
+	}
+
+	token, expiresOn, err := provider.AcquireToken(tenantID)
+	if err != nil {
+		return "", err
+	}
+
+	writeCachedToken(tenantID, mode, cachedToken{Token: token, ExpiresOn: expiresOn})
+
+	return token, nil
+}
+
+func acquireAuthTokenCurrentTenant() (string, error) {
+	setting, err := readSettings()
+	if err != nil {
+		return "", err
+	}
+
+	return acquireAuthToken(setting.ActiveTenant)
+}
+
+// cliTokenProvider delegates to the Azure CLI, reusing whatever account the user is already logged into.
+type cliTokenProvider struct{}
+
+func (cliTokenProvider) AcquireToken(tenantID string) (string, time.Time, error) {
+	cloud, err := currentCloud()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	args := []string{"account", "get-access-token", "--resource", cloud.ResourceManagerEndpoint, "-o", "json"}
+	if tenantID != "" {
+		args = append(args, "--tenant", tenantID)
+	}
+
+	out, err := exec.Command("az", args...).Output()
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("az cli token acquisition failed: %v", err)
+	}
+
+	var result struct {
+		AccessToken string `json:"accessToken"`
+		ExpiresOn   string `json:"expiresOn"`
+	}
+
+	if err := json.Unmarshal(out, &result); err != nil {
+		return "", time.Time{}, fmt.Errorf("Failed to parse az cli output: %v", err)
+	}
+
+	expiresOn, err := time.ParseInLocation("2006-01-02 15:04:05.999999", result.ExpiresOn, time.Local)
+	if err != nil {
+		expiresOn = time.Now().Add(time.Hour)
+	}
+
+	return "Bearer " + result.AccessToken, expiresOn, nil
+}
+
+// servicePrincipalTokenProvider authenticates with a client id/secret via the AAD token endpoint.
+type servicePrincipalTokenProvider struct{}
+
+func (servicePrincipalTokenProvider) AcquireToken(tenantID string) (string, time.Time, error) {
+	clientID := os.Getenv("AZURE_CLIENT_ID")
+	clientSecret := os.Getenv("AZURE_CLIENT_SECRET")
+
+	if tenantID == "" {
+		tenantID = os.Getenv("AZURE_TENANT_ID")
+	}
+
+	if tenantID == "" || clientID == "" {
+		return "", time.Time{}, fmt.Errorf("AZURE_TENANT_ID and AZURE_CLIENT_ID must be set for sp auth mode")
+	}
+
+	if clientSecret == "" {
+		return "", time.Time{}, fmt.Errorf("AZURE_CLIENT_SECRET must be set for sp auth mode")
+	}
+
+	cloud, err := currentCloud()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	return acquireTokenClientSecret(tenantID, clientID, clientSecret, cloud.ResourceManagerAudience, cloud.ActiveDirectoryEndpoint)
+}
+
+// managedIdentityTokenProvider acquires a token from the Azure Instance Metadata Service.
+type managedIdentityTokenProvider struct{}
+
+func (managedIdentityTokenProvider) AcquireToken(tenantID string) (string, time.Time, error) {
+	cloud, err := currentCloud()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	url := fmt.Sprintf("%s?api-version=2018-02-01&resource=%s", imdsTokenEndpoint, cloud.ResourceManagerAudience)
+	if clientID := os.Getenv("AZURE_CLIENT_ID"); clientID != "" {
+		url = url + "&client_id=" + clientID
+	}
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	req.Header.Set("Metadata", "true")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("IMDS request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	buf, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return "", time.Time{}, fmt.Errorf("IMDS request failed, status: %s, body: %s", resp.Status, string(buf))
+	}
+
+	var result struct {
+		AccessToken string `json:"access_token"`
+		ExpiresOn   string `json:"expires_on"`
+	}
+
+	if err := json.Unmarshal(buf, &result); err != nil {
+		return "", time.Time{}, fmt.Errorf("Failed to parse IMDS response: %v", err)
+	}
+
+	expiresOn := parseUnixSeconds(result.ExpiresOn)
+
+	return "Bearer " + result.AccessToken, expiresOn, nil
+}
+
+// deviceCodeTokenProvider implements the OAuth2 device authorization grant against AAD.
+type deviceCodeTokenProvider struct{}
+
+func (deviceCodeTokenProvider) AcquireToken(tenantID string) (string, time.Time, error) {
+	if tenantID == "" {
+		tenantID = "common"
+	}
+
+	clientID := os.Getenv("AZURE_CLIENT_ID")
+	if clientID == "" {
+		clientID = defaultDeviceCodeClientID
+	}
+
+	cloud, err := currentCloud()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	authority := cloud.ActiveDirectoryEndpoint + "/" + tenantID
+
+	deviceCodeResp, err := startDeviceCodeFlow(authority, clientID, cloud.ResourceManagerAudience)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	fmt.Println(deviceCodeResp.Message)
+
+	return pollDeviceCodeToken(authority, clientID, deviceCodeResp)
+}
+
+const defaultDeviceCodeClientID = "04b07795-8ddb-461a-bbee-02f9e1bf7b46"
+
+type deviceCodeResponse struct {
+	DeviceCode      string `json:"device_code"`
+	UserCode        string `json:"user_code"`
+	VerificationURI string `json:"verification_uri"`
+	ExpiresIn       int    `json:"expires_in"`
+	Interval        int    `json:"interval"`
+	Message         string `json:"message"`
+}
+
+func startDeviceCodeFlow(authority, clientID, resource string) (deviceCodeResponse, error) {
+	form := strings.NewReader(url.Values{
+		"client_id": {clientID},
+		"resource":  {resource},
+	}.Encode())
+
+	resp, err := http.Post(authority+"/oauth2/devicecode", "application/x-www-form-urlencoded", form)
+	if err != nil {
+		return deviceCodeResponse{}, fmt.Errorf("Failed to start device code flow: %v", err)
+	}
+	defer resp.Body.Close()
+
+	buf, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return deviceCodeResponse{}, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return deviceCodeResponse{}, fmt.Errorf("Failed to start device code flow, status: %s, body: %s", resp.Status, string(buf))
+	}
+
+	var dc deviceCodeResponse
+	if err := json.Unmarshal(buf, &dc); err != nil {
+		return deviceCodeResponse{}, err
+	}
+
+	return dc, nil
+}
+
+func pollDeviceCodeToken(authority, clientID string, dc deviceCodeResponse) (string, time.Time, error) {
+	interval := dc.Interval
+	if interval <= 0 {
+		interval = 5
+	}
+
+	deadline := time.Now().Add(time.Duration(dc.ExpiresIn) * time.Second)
+
+	for time.Now().Before(deadline) {
+		time.Sleep(time.Duration(interval) * time.Second)
+
+		form := strings.NewReader(url.Values{
+			"grant_type": {"urn:ietf:params:oauth:grant-type:device_code"},
+			"client_id":  {clientID},
+			"code":       {dc.DeviceCode},
+		}.Encode())
+
+		resp, err := http.Post(authority+"/oauth2/token", "application/x-www-form-urlencoded", form)
+		if err != nil {
+			return "", time.Time{}, fmt.Errorf("Device code polling failed: %v", err)
+		}
+
+		buf, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return "", time.Time{}, err
+		}
+
+		var result struct {
+			AccessToken string `json:"access_token"`
+			ExpiresIn   string `json:"expires_in"`
+			Error       string `json:"error"`
+		}
+
+		if err := json.Unmarshal(buf, &result); err != nil {
+			return "", time.Time{}, err
+		}
+
+		switch result.Error {
+		case "":
+			seconds := parseUnixSeconds(result.ExpiresIn)
+			return "Bearer " + result.AccessToken, seconds, nil
+		case "authorization_pending":
+			continue
+		case "slow_down":
+			interval += 5
+			continue
+		default:
+			return "", time.Time{}, fmt.Errorf("Device code flow failed: %s", result.Error)
+		}
+	}
+
+	return "", time.Time{}, fmt.Errorf("Device code flow timed out")
+}
+
+func acquireTokenClientSecret(tenantID, clientID, clientSecret, resource, aadEndpoint string) (string, time.Time, error) {
+	authority := aadEndpoint + "/" + tenantID
+
+	form := strings.NewReader(url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {clientID},
+		"client_secret": {clientSecret},
+		"resource":      {resource},
+	}.Encode())
+
+	resp, err := http.Post(authority+"/oauth2/token", "application/x-www-form-urlencoded", form)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("Service principal token acquisition failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	buf, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return "", time.Time{}, fmt.Errorf("Service principal token acquisition failed, status: %s, body: %s", resp.Status, string(buf))
+	}
+
+	var result struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   string `json:"expires_in"`
+	}
+
+	if err := json.Unmarshal(buf, &result); err != nil {
+		return "", time.Time{}, err
+	}
+
+	return "Bearer " + result.AccessToken, parseUnixSeconds(result.ExpiresIn), nil
+}
+
+func parseUnixSeconds(s string) time.Time {
+	var seconds int64
+	if _, err := fmt.Sscanf(s, "%d", &seconds); err != nil {
+		return time.Now().Add(time.Hour)
+	}
+
+	return time.Unix(seconds, 0)
+}
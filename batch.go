@@ -0,0 +1,298 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/urfave/cli"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	flagParallel   = "parallel"
+	flagServerSide = "server-side"
+
+	serverBatchAPIVersion = "2020-06-01"
+)
+
+// batchRequest describes a single ARM call within a batch file. Body is kept as interface{} so
+// the same struct can be populated from either a JSON or a YAML batch file.
+type batchRequest struct {
+	ID        string            `json:"id" yaml:"id"`
+	Method    string            `json:"method" yaml:"method"`
+	URL       string            `json:"url" yaml:"url"`
+	Headers   map[string]string `json:"headers,omitempty" yaml:"headers,omitempty"`
+	Body      interface{}       `json:"body,omitempty" yaml:"body,omitempty"`
+	DependsOn []string          `json:"dependsOn,omitempty" yaml:"dependsOn,omitempty"`
+}
+
+type batchResult struct {
+	ID      string            `json:"id"`
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Elapsed string            `json:"elapsed"`
+	Body    json.RawMessage   `json:"body,omitempty"`
+	Error   string            `json:"error,omitempty"`
+}
+
+func runBatch(c *cli.Context) error {
+	if c.NArg() == 0 {
+		return fmt.Errorf("No batch file specified")
+	}
+
+	requests, err := readBatchFile(c.Args().First())
+	if err != nil {
+		return fmt.Errorf("Failed to read batch file: %v", err)
+	}
+
+	token, err := acquireAuthTokenCurrentTenant()
+	if err != nil {
+		return fmt.Errorf("Failed to acquire auth token: %v", err)
+	}
+
+	var results []batchResult
+	if c.Bool(flagServerSide) {
+		results, err = runBatchServerSide(token, requests)
+	} else {
+		parallel := c.Int(flagParallel)
+		if parallel < 1 {
+			parallel = 1
+		}
+		results, err = runBatchLocal(token, requests, parallel)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	buf, _ := json.Marshal(results)
+	fmt.Println(prettyJSON(buf))
+
+	return nil
+}
+
+func readBatchFile(path string) ([]batchRequest, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var requests []batchRequest
+	if err := yaml.Unmarshal(buf, &requests); err != nil {
+		return nil, err
+	}
+
+	for i := range requests {
+		if requests[i].ID == "" {
+			requests[i].ID = fmt.Sprintf("%d", i)
+		}
+		if requests[i].Method == "" {
+			requests[i].Method = "GET"
+		}
+	}
+
+	return requests, nil
+}
+
+// runBatchLocal executes each request against ARM directly, honoring dependsOn and running up to
+// `parallel` requests concurrently once their dependencies have completed.
+func runBatchLocal(token string, requests []batchRequest, parallel int) ([]batchResult, error) {
+	client := &http.Client{}
+
+	done := make(map[string]bool, len(requests))
+	results := make(map[string]batchResult, len(requests))
+	var mu sync.Mutex
+
+	remaining := requests
+	sem := make(chan struct{}, parallel)
+
+	for len(remaining) > 0 {
+		var ready []batchRequest
+		var next []batchRequest
+
+		for _, r := range remaining {
+			if dependenciesSatisfied(r.DependsOn, done) {
+				ready = append(ready, r)
+			} else {
+				next = append(next, r)
+			}
+		}
+
+		if len(ready) == 0 {
+			return nil, fmt.Errorf("Unresolvable dependsOn among remaining batch items")
+		}
+
+		var wg sync.WaitGroup
+		for _, r := range ready {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func(r batchRequest) {
+				defer wg.Done()
+				defer func() { <-sem }()
+
+				result := executeBatchRequest(client, token, r)
+
+				mu.Lock()
+				results[r.ID] = result
+				done[r.ID] = true
+				mu.Unlock()
+			}(r)
+		}
+		wg.Wait()
+
+		remaining = next
+	}
+
+	ordered := make([]batchResult, 0, len(requests))
+	for _, r := range requests {
+		ordered = append(ordered, results[r.ID])
+	}
+
+	return ordered, nil
+}
+
+func dependenciesSatisfied(dependsOn []string, done map[string]bool) bool {
+	for _, dep := range dependsOn {
+		if !done[dep] {
+			return false
+		}
+	}
+	return true
+}
+
+func executeBatchRequest(client *http.Client, token string, r batchRequest) batchResult {
+	start := time.Now()
+
+	url, err := getRequestURL(r.URL)
+	if err != nil {
+		return batchResult{ID: r.ID, Error: err.Error()}
+	}
+
+	var bodyBytes []byte
+	if r.Body != nil {
+		bodyBytes, _ = json.Marshal(r.Body)
+	}
+
+	req, err := http.NewRequest(strings.ToUpper(r.Method), url, bytes.NewReader(bodyBytes))
+	if err != nil {
+		return batchResult{ID: r.ID, Error: err.Error()}
+	}
+
+	req.Header.Set("Authorization", token)
+	req.Header.Set("User-Agent", userAgentStr)
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range r.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return batchResult{ID: r.ID, Error: err.Error(), Elapsed: time.Since(start).String()}
+	}
+	defer resp.Body.Close()
+
+	buf, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return batchResult{ID: r.ID, Error: err.Error(), Elapsed: time.Since(start).String()}
+	}
+
+	return batchResult{
+		ID:      r.ID,
+		Status:  resp.StatusCode,
+		Headers: flattenHeaders(resp.Header),
+		Elapsed: time.Since(start).String(),
+		Body:    buf,
+	}
+}
+
+func flattenHeaders(h http.Header) map[string]string {
+	flat := make(map[string]string, len(h))
+	for k := range h {
+		flat[k] = h.Get(k)
+	}
+	return flat
+}
+
+// runBatchServerSide wraps the batch into ARM's native batch envelope (POST /batch) so a single
+// HTTP round trip amortizes across all requests, then unpacks the aggregated response.
+func runBatchServerSide(token string, requests []batchRequest) ([]batchResult, error) {
+	type serverBatchEntry struct {
+		HTTPMethod string      `json:"httpMethod"`
+		URL        string      `json:"url"`
+		Content    interface{} `json:"content,omitempty"`
+		Name       string      `json:"name"`
+	}
+
+	entries := make([]serverBatchEntry, 0, len(requests))
+	for _, r := range requests {
+		entries = append(entries, serverBatchEntry{
+			HTTPMethod: strings.ToUpper(r.Method),
+			URL:        r.URL,
+			Content:    r.Body,
+			Name:       r.ID,
+		})
+	}
+
+	envelope, err := json.Marshal(struct {
+		Requests []serverBatchEntry `json:"requests"`
+	}{Requests: entries})
+	if err != nil {
+		return nil, err
+	}
+
+	url, err := getRequestURL("/batch?api-version=" + serverBatchAPIVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	req, _ := http.NewRequest("POST", url, bytes.NewReader(envelope))
+	req.Header.Set("Authorization", token)
+	req.Header.Set("User-Agent", userAgentStr)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("Server-side batch request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	buf, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Server-side batch request failed, status: %s, body: %s", resp.Status, string(buf))
+	}
+
+	var parsed struct {
+		Responses []struct {
+			Name           string            `json:"name"`
+			HTTPStatusCode int               `json:"httpStatusCode"`
+			Headers        map[string]string `json:"headers,omitempty"`
+			Content        json.RawMessage   `json:"content,omitempty"`
+		} `json:"responses"`
+	}
+
+	if err := json.Unmarshal(buf, &parsed); err != nil {
+		return nil, fmt.Errorf("Failed to parse server-side batch response: %v", err)
+	}
+
+	results := make([]batchResult, 0, len(parsed.Responses))
+	for _, r := range parsed.Responses {
+		results = append(results, batchResult{
+			ID:      r.Name,
+			Status:  r.HTTPStatusCode,
+			Headers: r.Headers,
+			Body:    r.Content,
+		})
+	}
+
+	return results, nil
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/urfave/cli"
+)
+
+const (
+	envCloud  = "ARMCLIENT_CLOUD"
+	flagCloud = "cloud"
+
+	cloudAzurePublic       = "AzurePublic"
+	cloudAzureUSGovernment = "AzureUSGovernment"
+	cloudAzureChina        = "AzureChina"
+	cloudAzureGermany      = "AzureGermany"
+)
+
+// cloudEnvironment describes the set of endpoints needed to talk to a specific Azure (or Azure Stack) instance.
+type cloudEnvironment struct {
+	Name                    string `json:"name"`
+	ResourceManagerEndpoint string `json:"resourceManagerEndpoint"`
+	ActiveDirectoryEndpoint string `json:"activeDirectoryEndpoint"`
+	ResourceManagerAudience string `json:"resourceManagerAudience"`
+	GraphEndpoint           string `json:"graphEndpoint,omitempty"`
+	StorageEndpointSuffix   string `json:"storageEndpointSuffix,omitempty"`
+}
+
+var builtinClouds = map[string]cloudEnvironment{
+	cloudAzurePublic: {
+		Name:                    cloudAzurePublic,
+		ResourceManagerEndpoint: "https://management.azure.com",
+		ActiveDirectoryEndpoint: "https://login.microsoftonline.com",
+		ResourceManagerAudience: "https://management.azure.com/",
+		GraphEndpoint:           "https://graph.windows.net",
+		StorageEndpointSuffix:   "core.windows.net",
+	},
+	cloudAzureUSGovernment: {
+		Name:                    cloudAzureUSGovernment,
+		ResourceManagerEndpoint: "https://management.usgovcloudapi.net",
+		ActiveDirectoryEndpoint: "https://login.microsoftonline.us",
+		ResourceManagerAudience: "https://management.usgovcloudapi.net/",
+		GraphEndpoint:           "https://graph.windows.net",
+		StorageEndpointSuffix:   "core.usgovcloudapi.net",
+	},
+	cloudAzureChina: {
+		Name:                    cloudAzureChina,
+		ResourceManagerEndpoint: "https://management.chinacloudapi.cn",
+		ActiveDirectoryEndpoint: "https://login.chinacloudapi.cn",
+		ResourceManagerAudience: "https://management.chinacloudapi.cn/",
+		GraphEndpoint:           "https://graph.chinacloudapi.cn",
+		StorageEndpointSuffix:   "core.chinacloudapi.cn",
+	},
+	cloudAzureGermany: {
+		Name:                    cloudAzureGermany,
+		ResourceManagerEndpoint: "https://management.microsoftazure.de",
+		ActiveDirectoryEndpoint: "https://login.microsoftonline.de",
+		ResourceManagerAudience: "https://management.microsoftazure.de/",
+		GraphEndpoint:           "https://graph.cloudapi.de",
+		StorageEndpointSuffix:   "core.cloudapi.de",
+	},
+}
+
+func currentCloudName() string {
+	if name := os.Getenv(envCloud); name != "" {
+		return name
+	}
+
+	setting, err := readSettings()
+	if err == nil && setting.ActiveCloud != "" {
+		return setting.ActiveCloud
+	}
+
+	return cloudAzurePublic
+}
+
+func currentCloud() (cloudEnvironment, error) {
+	name := currentCloudName()
+
+	if env, ok := builtinClouds[name]; ok {
+		return env, nil
+	}
+
+	setting, err := readSettings()
+	if err != nil {
+		return cloudEnvironment{}, err
+	}
+
+	if env, ok := setting.Clouds[name]; ok {
+		return env, nil
+	}
+
+	return cloudEnvironment{}, fmt.Errorf("Unknown cloud: %s. Register it first with 'armclient cloud register'", name)
+}
+
+func printCloud(c *cli.Context) error {
+	env, err := currentCloud()
+	if err != nil {
+		return err
+	}
+
+	buf, _ := json.Marshal(env)
+	fmt.Println(prettyJSON(buf))
+
+	return nil
+}
+
+func setActiveCloud(c *cli.Context) error {
+	if c.NArg() == 0 {
+		return fmt.Errorf("No cloud name specified")
+	}
+
+	name := c.Args().First()
+
+	if _, ok := builtinClouds[name]; !ok {
+		setting, err := readSettings()
+		if err != nil {
+			return err
+		}
+
+		if _, ok := setting.Clouds[name]; !ok {
+			return fmt.Errorf("Unknown cloud: %s. Register it first with 'armclient cloud register'", name)
+		}
+	}
+
+	return saveSettings(settings{ActiveCloud: name})
+}
+
+func registerCloud(c *cli.Context) error {
+	if c.NArg() == 0 {
+		return fmt.Errorf("No cloud name specified")
+	}
+
+	name := c.Args().First()
+	metadataURL := c.String(strings.Split(flagMetadataURL, ",")[0])
+
+	var env cloudEnvironment
+	if metadataURL != "" {
+		fetched, err := fetchCloudMetadata(metadataURL)
+		if err != nil {
+			return fmt.Errorf("Failed to fetch cloud metadata: %v", err)
+		}
+		env = fetched
+	} else {
+		env = cloudEnvironment{
+			ResourceManagerEndpoint: c.String(strings.Split(flagARMEndpoint, ",")[0]),
+			ActiveDirectoryEndpoint: c.String(strings.Split(flagAADEndpoint, ",")[0]),
+		}
+		if env.ResourceManagerEndpoint == "" || env.ActiveDirectoryEndpoint == "" {
+			return fmt.Errorf("Either --metadata-url or both --arm-endpoint and --aad-endpoint must be specified")
+		}
+		env.ResourceManagerAudience = env.ResourceManagerEndpoint + "/"
+	}
+
+	env.Name = name
+
+	setting, err := readSettings()
+	if err != nil {
+		return err
+	}
+
+	if setting.Clouds == nil {
+		setting.Clouds = map[string]cloudEnvironment{}
+	}
+	setting.Clouds[name] = env
+
+	return saveSettings(setting)
+}
+
+// fetchCloudMetadata auto-populates a cloud definition from ARM's well-known metadata endpoint.
+func fetchCloudMetadata(armEndpoint string) (cloudEnvironment, error) {
+	url := strings.TrimSuffix(armEndpoint, "/") + "/metadata/endpoints?api-version=2019-05-01"
+
+	resp, err := http.Get(url)
+	if err != nil {
+		return cloudEnvironment{}, err
+	}
+	defer resp.Body.Close()
+
+	buf, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return cloudEnvironment{}, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return cloudEnvironment{}, fmt.Errorf("metadata endpoint returned status: %s", resp.Status)
+	}
+
+	var metadata struct {
+		Authentication struct {
+			LoginEndpoint string   `json:"loginEndpoint"`
+			Audiences     []string `json:"audiences"`
+		} `json:"authentication"`
+		Graph    string `json:"graphEndpoint"`
+		Suffixes struct {
+			Storage string `json:"storage"`
+		} `json:"suffixes"`
+	}
+
+	if err := json.Unmarshal(buf, &metadata); err != nil {
+		return cloudEnvironment{}, err
+	}
+
+	env := cloudEnvironment{
+		ResourceManagerEndpoint: strings.TrimSuffix(armEndpoint, "/"),
+		ActiveDirectoryEndpoint: strings.TrimSuffix(metadata.Authentication.LoginEndpoint, "/"),
+		GraphEndpoint:           metadata.Graph,
+		StorageEndpointSuffix:   metadata.Suffixes.Storage,
+	}
+
+	if len(metadata.Authentication.Audiences) > 0 {
+		env.ResourceManagerAudience = metadata.Authentication.Audiences[0]
+	}
+
+	return env, nil
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/urfave/cli"
+)
+
+var authorizationURITenantRegex = regexp.MustCompile(`authorization_uri="https://[^/]+/([^/"]+)"`)
+
+// tenantFromChallenge extracts the tenant GUID out of a WWW-Authenticate challenge header,
+// e.g. `Bearer authorization_uri="https://login.microsoftonline.com/<tenant>", error="..."`.
+func tenantFromChallenge(header string) (string, bool) {
+	matches := authorizationURITenantRegex.FindStringSubmatch(header)
+	if len(matches) != 2 {
+		return "", false
+	}
+
+	return matches[1], true
+}
+
+// subscriptionIDFromPath extracts the subscription id out of an ARM request path, if present.
+func subscriptionIDFromPath(path string) (string, bool) {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for i, segment := range segments {
+		if strings.EqualFold(segment, "subscriptions") && i+1 < len(segments) {
+			return segments[i+1], true
+		}
+	}
+
+	return "", false
+}
+
+// discoverTenantForSubscription probes ARM unauthenticated and reads the tenant GUID off the
+// resulting 401's WWW-Authenticate header, caching the subscription->tenant mapping.
+func discoverTenantForSubscription(subscriptionID string) (string, error) {
+	setting, err := readSettings()
+	if err == nil {
+		if tenantID, ok := setting.SubscriptionTenants[subscriptionID]; ok {
+			return tenantID, nil
+		}
+	}
+
+	url, err := getRequestURL("/subscriptions/" + subscriptionID + "?api-version=2016-06-01")
+	if err != nil {
+		return "", err
+	}
+
+	req, _ := http.NewRequest("GET", url, nil)
+	req.Header.Set("User-Agent", userAgentStr)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	ioutil.ReadAll(resp.Body)
+
+	tenantID, ok := tenantFromChallenge(resp.Header.Get("WWW-Authenticate"))
+	if !ok {
+		return "", nil
+	}
+
+	cacheSubscriptionTenant(subscriptionID, tenantID)
+
+	return tenantID, nil
+}
+
+func discoverTenant(c *cli.Context) error {
+	if c.NArg() == 0 {
+		return fmt.Errorf("No subscription Id specified")
+	}
+
+	tenantID, err := discoverTenantForSubscription(c.Args().First())
+	if err != nil {
+		return fmt.Errorf("Failed to discover tenant: %v", err)
+	}
+
+	if tenantID == "" {
+		return fmt.Errorf("Could not determine tenant for subscription %s", c.Args().First())
+	}
+
+	fmt.Println(tenantID)
+
+	return nil
+}
+
+func cacheSubscriptionTenant(subscriptionID, tenantID string) {
+	saveSettings(settings{SubscriptionTenants: map[string]string{subscriptionID: tenantID}})
+}
+
+// retryWithDiscoveredTenant inspects a 401 response's WWW-Authenticate challenge for the tenant
+// ARM actually expects, re-acquires a token for it and retries the request once. Returns a nil
+// response (and nil error) when no tenant could be discovered, leaving the original 401 in place.
+func retryWithDiscoveredTenant(client *http.Client, original *http.Request, body []byte, response *http.Response) (*http.Response, string, error) {
+	tenantID, ok := tenantFromChallenge(response.Header.Get("WWW-Authenticate"))
+	if !ok {
+		return nil, "", nil
+	}
+
+	if subscriptionID, ok := subscriptionIDFromPath(original.URL.Path); ok {
+		cacheSubscriptionTenant(subscriptionID, tenantID)
+	}
+
+	response.Body.Close()
+
+	token, err := acquireAuthToken(tenantID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	retryReq, err := http.NewRequest(original.Method, original.URL.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, "", err
+	}
+	retryReq.Header = original.Header.Clone()
+	retryReq.Header.Set("Authorization", token)
+
+	retried, err := client.Do(retryReq)
+	return retried, token, err
+}
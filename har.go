@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	flagLogFile = "log-file"
+	flagLogAuth = "log-auth"
+	flagDryRun  = "dry-run"
+
+	harVersion = "1.2"
+	redacted   = "***redacted***"
+)
+
+type harLog struct {
+	Log harLogEntries `json:"log"`
+}
+
+type harLogEntries struct {
+	Version string     `json:"version"`
+	Creator harCreator `json:"creator"`
+	Entries []harEntry `json:"entries"`
+}
+
+type harCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type harEntry struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+}
+
+type harHeader struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harRequest struct {
+	Method      string      `json:"method"`
+	URL         string      `json:"url"`
+	HTTPVersion string      `json:"httpVersion"`
+	Headers     []harHeader `json:"headers"`
+	PostData    *harContent `json:"postData,omitempty"`
+}
+
+type harResponse struct {
+	Status      int         `json:"status"`
+	StatusText  string      `json:"statusText"`
+	HTTPVersion string      `json:"httpVersion"`
+	Headers     []harHeader `json:"headers"`
+	Content     harContent  `json:"content"`
+}
+
+type harContent struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+}
+
+type harTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+func harHeaders(h http.Header, logAuth bool) []harHeader {
+	headers := make([]harHeader, 0, len(h))
+	for name, values := range h {
+		value := strings.Join(values, ",")
+		if !logAuth && strings.EqualFold(name, "Authorization") {
+			value = redacted
+		}
+		headers = append(headers, harHeader{Name: name, Value: value})
+	}
+	return headers
+}
+
+// appendHARLogEntry records one request/response pair in HTTP Archive format, appending to
+// logFile so the file accumulates a full session's traffic across invocations.
+func appendHARLogEntry(logFile string, req *http.Request, reqBody []byte, resp *http.Response, respBody []byte, startedAt time.Time, elapsed time.Duration, logAuth bool) error {
+	entry := harEntry{
+		StartedDateTime: startedAt.Format(time.RFC3339Nano),
+		Time:            float64(elapsed.Milliseconds()),
+		Request: harRequest{
+			Method:      req.Method,
+			URL:         req.URL.String(),
+			HTTPVersion: "HTTP/1.1",
+			Headers:     harHeaders(req.Header, logAuth),
+		},
+		Response: harResponse{
+			Status:      resp.StatusCode,
+			StatusText:  http.StatusText(resp.StatusCode),
+			HTTPVersion: "HTTP/1.1",
+			Headers:     harHeaders(resp.Header, logAuth),
+			Content: harContent{
+				Size:     len(respBody),
+				MimeType: resp.Header.Get("Content-Type"),
+				Text:     string(respBody),
+			},
+		},
+		Timings: harTimings{Send: 0, Wait: float64(elapsed.Milliseconds()), Receive: 0},
+	}
+
+	if len(reqBody) > 0 {
+		entry.Request.PostData = &harContent{
+			Size:     len(reqBody),
+			MimeType: req.Header.Get("Content-Type"),
+			Text:     string(reqBody),
+		}
+	}
+
+	log, err := readHARLog(logFile)
+	if err != nil {
+		return err
+	}
+
+	log.Log.Entries = append(log.Log.Entries, entry)
+
+	buf, err := json.MarshalIndent(log, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(logFile, buf, 0644)
+}
+
+func readHARLog(logFile string) (harLog, error) {
+	buf, err := ioutil.ReadFile(logFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return harLog{Log: harLogEntries{
+				Version: harVersion,
+				Creator: harCreator{Name: userAgentStr, Version: appVersion},
+				Entries: []harEntry{},
+			}}, nil
+		}
+		return harLog{}, err
+	}
+
+	var log harLog
+	if err := json.Unmarshal(buf, &log); err != nil {
+		return harLog{}, err
+	}
+
+	return log, nil
+}
+
+// printDryRun prints the fully-formed request without sending it, redacting the Authorization
+// header by default to match the --log-file convention.
+func printDryRun(req *http.Request, body []byte, logAuth bool) {
+	fmt.Printf("%s %s\n", req.Method, req.URL.String())
+	for _, h := range harHeaders(req.Header, logAuth) {
+		fmt.Printf("%s: %s\n", h.Name, h.Value)
+	}
+	if len(body) > 0 {
+		fmt.Println()
+		fmt.Println(prettyJSON(body))
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	flagWait         = "wait, w"
+	flagWaitTimeout  = "wait-timeout"
+	flagPollInterval = "poll-interval"
+
+	defaultWaitTimeout  = 30 * time.Minute
+	defaultPollInterval = 10 * time.Second
+)
+
+// waitForOperation polls an ARM long-running operation (as signalled by Azure-AsyncOperation or
+// Location on a 201/202 response) until it reaches a terminal state, per the Azure-AsyncOperation
+// polling contract. It returns the final poll response together with its already-drained body
+// (the caller must not attempt to read response.Body again), or the original response unchanged
+// with a nil body if the request wasn't actually a long-running operation.
+func waitForOperation(client *http.Client, token string, response *http.Response, timeout, interval time.Duration, verbose bool) (*http.Response, []byte, error) {
+	statusURL := response.Header.Get("Azure-AsyncOperation")
+	usingLocation := false
+	if statusURL == "" {
+		statusURL = response.Header.Get("Location")
+		usingLocation = true
+	}
+
+	if statusURL == "" || (response.StatusCode != http.StatusCreated && response.StatusCode != http.StatusAccepted) {
+		return response, nil, nil
+	}
+
+	deadline := time.Now().Add(timeout)
+
+	for {
+		if time.Now().After(deadline) {
+			return nil, nil, fmt.Errorf("Timed out after %s waiting for operation to complete", timeout)
+		}
+
+		req, _ := http.NewRequest("GET", statusURL, nil)
+		req.Header.Set("Authorization", token)
+		req.Header.Set("User-Agent", userAgentStr)
+
+		poll, err := client.Do(req)
+		if err != nil {
+			return nil, nil, fmt.Errorf("Failed to poll operation status: %v", err)
+		}
+
+		buf, err := ioutil.ReadAll(poll.Body)
+		poll.Body.Close()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		status, terminal := operationStatus(poll, buf, usingLocation)
+
+		if verbose {
+			fmt.Printf("Polling %s: %s\n", statusURL, status)
+		}
+
+		if terminal {
+			if !isSuccessStatus(status) {
+				return poll, buf, fmt.Errorf("Operation ended in non-success state: %s", status)
+			}
+			return poll, buf, nil
+		}
+
+		time.Sleep(retryAfter(poll, interval))
+	}
+}
+
+func isSuccessStatus(status string) bool {
+	return status == "Succeeded" || status == ""
+}
+
+// operationStatus extracts the operation's status from a poll response, per the
+// Azure-AsyncOperation contract (a top-level "status" field) or, when polling a plain Location
+// header, from the resource's "properties.provisioningState" once the resource is returned.
+func operationStatus(poll *http.Response, body []byte, usingLocation bool) (status string, terminal bool) {
+	if usingLocation {
+		if poll.StatusCode == http.StatusAccepted {
+			return "InProgress", false
+		}
+
+		var resource struct {
+			Properties struct {
+				ProvisioningState string `json:"provisioningState"`
+			} `json:"properties"`
+		}
+
+		if json.Unmarshal(body, &resource) == nil && resource.Properties.ProvisioningState != "" {
+			return resource.Properties.ProvisioningState, isTerminalProvisioningState(resource.Properties.ProvisioningState)
+		}
+
+		return "Succeeded", true
+	}
+
+	var operation struct {
+		Status string `json:"status"`
+	}
+
+	if json.Unmarshal(body, &operation) != nil || operation.Status == "" {
+		return "Unknown", true
+	}
+
+	return operation.Status, isTerminalProvisioningState(operation.Status)
+}
+
+func isTerminalProvisioningState(state string) bool {
+	return state == "Succeeded" || state == "Failed" || state == "Canceled"
+}
+
+func retryAfter(response *http.Response, fallback time.Duration) time.Duration {
+	if header := response.Header.Get("Retry-After"); header != "" {
+		if seconds, err := strconv.Atoi(header); err == nil {
+			return time.Duration(seconds) * time.Second
+		}
+	}
+
+	return fallback
+}
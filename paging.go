@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+)
+
+const (
+	flagAllPages = "all-pages, a"
+	flagMaxPages = "max-pages"
+
+	defaultMaxPages = 100
+)
+
+type pagedResponse struct {
+	Value    []json.RawMessage `json:"value"`
+	NextLink string            `json:"nextLink"`
+}
+
+// followAllPages transparently chases an ARM list response's nextLink until exhausted or
+// maxPages is reached, returning a single document with the concatenated value array. If the
+// response isn't a pageable list (no "value" array), the original body is returned unchanged.
+func followAllPages(client *http.Client, headers http.Header, firstBody []byte, maxPages int, verbose bool) ([]byte, error) {
+	var page pagedResponse
+	if err := json.Unmarshal(firstBody, &page); err != nil || page.Value == nil {
+		return firstBody, nil
+	}
+
+	items := append([]json.RawMessage{}, page.Value...)
+
+	if verbose {
+		fmt.Printf("Page 1: %d items\n", len(page.Value))
+	}
+
+	pageCount := 1
+	for page.NextLink != "" && pageCount < maxPages {
+		nextLink := page.NextLink
+
+		req, err := http.NewRequest("GET", nextLink, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header = headers.Clone()
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to follow nextLink: %v", err)
+		}
+
+		buf, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		if err := json.Unmarshal(buf, &page); err != nil {
+			return nil, fmt.Errorf("Failed to parse paged response: %v", err)
+		}
+
+		items = append(items, page.Value...)
+		pageCount++
+
+		if verbose {
+			fmt.Printf("Page %d: %s, %d items\n", pageCount, nextLink, len(page.Value))
+		}
+	}
+
+	merged, err := json.Marshal(struct {
+		Value []json.RawMessage `json:"value"`
+	}{Value: items})
+	if err != nil {
+		return nil, err
+	}
+
+	return merged, nil
+}
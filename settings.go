@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+type settings struct {
+	ActiveTenant        string                      `json:"activeTenant,omitempty"`
+	ActiveCloud         string                      `json:"activeCloud,omitempty"`
+	Clouds              map[string]cloudEnvironment `json:"clouds,omitempty"`
+	SubscriptionTenants map[string]string           `json:"subscriptionTenants,omitempty"`
+}
+
+func settingsFilePath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	dir := filepath.Join(home, ".armclient")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "settings.json"), nil
+}
+
+func readSettings() (settings, error) {
+	path, err := settingsFilePath()
+	if err != nil {
+		return settings{}, err
+	}
+
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return settings{}, nil
+		}
+		return settings{}, err
+	}
+
+	var s settings
+	if err := json.Unmarshal(buf, &s); err != nil {
+		return settings{}, err
+	}
+
+	return s, nil
+}
+
+func saveSettings(s settings) error {
+	path, err := settingsFilePath()
+	if err != nil {
+		return err
+	}
+
+	existing, err := readSettings()
+	if err != nil {
+		existing = settings{}
+	}
+
+	if s.ActiveTenant != "" {
+		existing.ActiveTenant = s.ActiveTenant
+	}
+
+	if s.ActiveCloud != "" {
+		existing.ActiveCloud = s.ActiveCloud
+	}
+
+	if s.Clouds != nil {
+		if existing.Clouds == nil {
+			existing.Clouds = map[string]cloudEnvironment{}
+		}
+		for name, env := range s.Clouds {
+			existing.Clouds[name] = env
+		}
+	}
+
+	if s.SubscriptionTenants != nil {
+		if existing.SubscriptionTenants == nil {
+			existing.SubscriptionTenants = map[string]string{}
+		}
+		for subscriptionID, tenantID := range s.SubscriptionTenants {
+			existing.SubscriptionTenants[subscriptionID] = tenantID
+		}
+	}
+
+	buf, err := json.MarshalIndent(existing, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, buf, 0600)
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+)
+
+type tenant struct {
+	TenantID string `json:"tenantId"`
+}
+
+func getTenants(token string) ([]tenant, error) {
+	url, err := getRequestURL("/tenants")
+	if err != nil {
+		return nil, err
+	}
+
+	req, _ := http.NewRequest("GET", url, nil)
+	req.Header.Set("Authorization", token)
+	req.Header.Set("User-Agent", userAgentStr)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	buf, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Failed to list tenants, status: %s", resp.Status)
+	}
+
+	var result struct {
+		Value []tenant `json:"value"`
+	}
+
+	if err := json.Unmarshal(buf, &result); err != nil {
+		return nil, err
+	}
+
+	return result.Value, nil
+}
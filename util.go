@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const defaultAPIVersion = "2019-05-01"
+
+func getRequestURL(path string) (string, error) {
+	if path == "" {
+		return "", fmt.Errorf("No path specified")
+	}
+
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+
+	cloud, err := currentCloud()
+	if err != nil {
+		return "", err
+	}
+
+	url := cloud.ResourceManagerEndpoint + path
+	if !strings.Contains(url, "api-version=") {
+		separator := "?"
+		if strings.Contains(url, "?") {
+			separator = "&"
+		}
+		url = url + separator + "api-version=" + defaultAPIVersion
+	}
+
+	return url, nil
+}
+
+func newUUID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+func prettyJSON(buf []byte) string {
+	var out bytes.Buffer
+	if err := json.Indent(&out, buf, "", "  "); err != nil {
+		return string(buf)
+	}
+
+	return out.String()
+}
+
+func responseDetail(req *http.Request, response *http.Response, elapsed time.Duration, headerNames []string) string {
+	var out bytes.Buffer
+
+	fmt.Fprintf(&out, "%s %s\n", req.Method, req.URL.String())
+	fmt.Fprintf(&out, "Status: %s, elapsed: %s\n", response.Status, elapsed.String())
+
+	for name, values := range response.Header {
+		fmt.Fprintf(&out, "%s: %s\n", name, strings.Join(values, ","))
+	}
+
+	for _, name := range headerNames {
+		fmt.Fprintf(&out, "Request header %s: %s\n", name, req.Header.Get(name))
+	}
+
+	return out.String()
+}